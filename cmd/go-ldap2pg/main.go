@@ -8,19 +8,8 @@ import (
 	"runtime/debug"
 
 	. "github.com/dalibo/ldap2pg/internal/ldap2pg"
-	ldap "github.com/go-ldap/ldap/v3"
-	"github.com/jackc/pgx/v4"
-	"gopkg.in/yaml.v3"
 )
 
-var data string = `
-toto: [1, "titi", null, 4.2]
-`
-
-type YamlConfig struct {
-	Toto []interface{} `yaml:"toto"`
-}
-
 func main() {
 	err := SetupLogging()
 	if err != nil {
@@ -45,55 +34,25 @@ func main() {
 	LogLevel.SetLevel(config.LogLevel)
 	Logger.Infow("Starting ldap2pg", "commit", ShortRevision, "version", Version, "runtime", runtime.Version())
 
-	Logger.Debugw("LDAP dial.", "uri", config.Ldap.Uri)
-	ldapconn, err := ldap.DialURL(config.Ldap.Uri)
+	ldapClient, err := NewLDAPClient(config.Ldap)
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer ldapconn.Close()
-	Logger.Debugw("LDAP simple bind.", "binddn", config.Ldap.BindDn)
-	err = ldapconn.Bind(config.Ldap.BindDn, config.Ldap.Password)
-	if err != nil {
-		Logger.Fatal(err)
+		Logger.Fatalw("Failed to connect to LDAP.", "error", err)
 	}
+	defer ldapClient.Close()
 
-	Logger.Debugw("Running LDAP whoami.")
-	wai, err := ldapconn.WhoAmI(nil)
+	pgInspector, err := NewPostgresInspector(config.Postgres)
 	if err != nil {
-		Logger.Fatal(err)
+		Logger.Fatalw("Failed to connect to PostgreSQL.", "error", err)
 	}
-	Logger.Debugw("LDAP whoami done.", "authzid", wai.AuthzID)
+	defer pgInspector.Close(context.Background())
 
-	y := YamlConfig{}
-	err = yaml.Unmarshal([]byte(data), &y)
+	syncer := NewSyncer(ldapClient, pgInspector, config.SyncMap)
+	syncer.DryRun = config.DryRun
+	syncer.DropUnmanaged = config.DropUnmanaged
+	err = syncer.Run(context.Background())
 	if err != nil {
-		Logger.Fatalw("Failed to parse YAML", "error", err)
-	}
-	log.Println("Len toto", len(y.Toto))
-	for i, value := range y.Toto {
-		switch t := value.(type) {
-		case int:
-			log.Printf("toto[%d] %T = %d", i, t, value.(int))
-		case string:
-			log.Printf("toto[%d] %T = %s", i, t, value.(string))
-		default:
-			log.Printf("toto[%d] %+v %T, unhandled.", i, value, t)
-		}
+		Logger.Fatalw("Sync failed.", "error", err)
 	}
-
-	pgconn, err := pgx.Connect(context.Background(), "")
-	if err != nil {
-		log.Fatalf("PostgreSQL connection error: %s", err)
-	}
-	defer pgconn.Close(context.Background())
-
-	var me string
-	err = pgconn.QueryRow(context.Background(), "SELECT CURRENT_USER;").Scan(&me)
-	if err != nil {
-		log.Fatalf("Failed to query: %s", err)
-	}
-
-	log.Printf("Running as %s.\n", me)
 }
 
 func showVersion() {
@@ -0,0 +1,152 @@
+package ldap2pg
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dalibo/ldap2pg/internal/ldap2pg/inspect"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
+)
+
+// Action tells main what to do once the configuration has been loaded.
+type Action int
+
+const (
+	RunAction Action = iota
+	ShowHelpAction
+	ShowVersionAction
+)
+
+// LdapConfig holds the connection parameters used to dial and bind to the
+// directory.
+type LdapConfig struct {
+	Uri      string `yaml:"uri"`
+	BindDn   string `yaml:"binddn"`
+	Password string `yaml:"password"`
+
+	SaslMech string `yaml:"sasl_mech"`
+	Keytab   string `yaml:"keytab"`
+
+	StartTLS      bool   `yaml:"starttls"`
+	TLSSkipVerify bool   `yaml:"tls_skip_verify"`
+	CAChain       string `yaml:"cachain"`
+
+	PageSize      uint32 `yaml:"page_size"`
+	ReferralDepth int    `yaml:"referral_hop_limit"`
+}
+
+// PostgresConfig holds the connection parameters used to reach the cluster
+// ldap2pg manages roles on, plus the knobs controlling what it is allowed
+// to touch there.
+type PostgresConfig struct {
+	Dsn         string   `yaml:"dsn"`
+	SessionRole string   `yaml:"session_role"`
+	Blacklist   []string `yaml:"blacklist"`
+
+	inspect.Overrides `yaml:",inline"`
+}
+
+// Config is the fully loaded, ready-to-use configuration of ldap2pg.
+type Config struct {
+	Action   Action
+	LogLevel zapcore.Level
+
+	ConfigFile    string
+	DryRun        bool
+	DropUnmanaged bool
+	Strict        bool
+
+	Ldap     LdapConfig
+	Postgres PostgresConfig
+	SyncMap  []interface{}
+}
+
+// fileConfig mirrors the ldap/postgres part of the on-disk YAML shape.
+// sync_map goes through NormalizeConfigRoot instead, since it needs
+// position-aware validation.
+type fileConfig struct {
+	Ldap     LdapConfig     `yaml:"ldap"`
+	Postgres PostgresConfig `yaml:"postgres"`
+}
+
+// LoadConfig parses CLI flags and, unless the action is ShowHelpAction or
+// ShowVersionAction, reads and normalizes the YAML configuration file.
+func LoadConfig() (config Config, err error) {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	help := flag.Bool("help", false, "Show this help message and exit.")
+	version := flag.Bool("version", false, "Show version and exit.")
+	verbose := flag.Bool("verbose", false, "Enable debug logging.")
+	dryRun := flag.Bool("dry-run", true, "Don't touch Postgres, just log what would be done.")
+	real := flag.Bool("real", false, "Apply changes to Postgres. Overrides --dry-run.")
+	dropUnmanaged := flag.Bool("drop-unmanaged", false, "Drop managed roles present in Postgres but not in sync_map.")
+	strict := flag.Bool("strict", false, "Reject unknown keys in the configuration file.")
+	configPath := flag.String("config", "ldap2pg.yml", "Path to the YAML configuration file.")
+	flag.Parse()
+
+	switch {
+	case *help:
+		config.Action = ShowHelpAction
+		return
+	case *version:
+		config.Action = ShowVersionAction
+		return
+	}
+	config.Action = RunAction
+
+	config.LogLevel = zapcore.InfoLevel
+	if *verbose {
+		config.LogLevel = zapcore.DebugLevel
+	}
+
+	config.DryRun = *dryRun && !*real
+	config.DropUnmanaged = *dropUnmanaged
+	config.Strict = *strict
+
+	config.ConfigFile = *configPath
+	buf, err := os.ReadFile(config.ConfigFile)
+	if err != nil {
+		err = fmt.Errorf("failed to read configuration file: %w", err)
+		return
+	}
+
+	var root yaml.Node
+	err = yaml.Unmarshal(buf, &root)
+	if err != nil {
+		err = fmt.Errorf("failed to parse configuration file: %w", err)
+		return
+	}
+
+	var raw fileConfig
+	err = root.Decode(&raw)
+	if err != nil {
+		err = fmt.Errorf("failed to parse configuration file: %w", err)
+		return
+	}
+	config.Ldap = raw.Ldap
+	config.Postgres = raw.Postgres
+
+	normalized, err := NormalizeConfigRoot(&root, config.Strict)
+	if err != nil {
+		err = fmt.Errorf("invalid configuration file: %w", err)
+		return
+	}
+	syncMap, ok := normalized["sync_map"].([]interface{})
+	if !ok {
+		err = fmt.Errorf("invalid configuration file: sync_map is not a list")
+		return
+	}
+	config.SyncMap = syncMap
+
+	return
+}
+
+// ShowHelp prints CLI usage to stderr.
+func ShowHelp() {
+	flag.Usage()
+}
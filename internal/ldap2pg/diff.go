@@ -0,0 +1,65 @@
+package ldap2pg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// diffRoles compares a sync item's wanted roles (from the directory)
+// against the roles currently present in the cluster and returns the SQL
+// statements needed to create or update them, in a stable, deterministic
+// order. It never drops anything — orphan roles are handled separately by
+// orphanRoles, once the whole sync_map has been resolved, so that each sync
+// item's statements can be applied in their own transaction.
+func diffRoles(wanted map[string]Role, present map[string]Role) (statements []string) {
+	names := make([]string, 0, len(wanted))
+	for name := range wanted {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		role := wanted[name]
+		if _, exists := present[name]; !exists {
+			statements = append(statements, fmt.Sprintf("CREATE ROLE %s WITH LOGIN;", quoteIdent(name)))
+		} else {
+			statements = append(statements, fmt.Sprintf("ALTER ROLE %s WITH LOGIN;", quoteIdent(name)))
+		}
+		if role.Comment != "" {
+			statements = append(statements, fmt.Sprintf(
+				"COMMENT ON ROLE %s IS %s;", quoteIdent(name), quoteLiteral(role.Comment),
+			))
+		}
+	}
+	return
+}
+
+// orphanRoles returns the DROP ROLE statements for roles present in the
+// cluster but wanted by no sync item, in a stable, deterministic order.
+// Only roles in managed are ever dropped, so roles outside ldap2pg's scope
+// (e.g. rds_* roles excluded via managed_roles_query) are never touched.
+func orphanRoles(wanted map[string]Role, present map[string]Role, managed map[string]bool) (statements []string) {
+	orphans := make([]string, 0)
+	for name := range present {
+		_, isWanted := wanted[name]
+		if !isWanted && managed[name] {
+			orphans = append(orphans, name)
+		}
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		statements = append(statements, fmt.Sprintf("DROP ROLE %s;", quoteIdent(name)))
+	}
+	return
+}
+
+func quoteIdent(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
@@ -0,0 +1,87 @@
+package ldap2pg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRoles(t *testing.T) {
+	cases := []struct {
+		name    string
+		wanted  map[string]Role
+		present map[string]Role
+		want    []string
+	}{
+		{
+			name:    "creates missing role",
+			wanted:  map[string]Role{"alice": {Name: "alice"}},
+			present: map[string]Role{},
+			want:    []string{`CREATE ROLE "alice" WITH LOGIN;`},
+		},
+		{
+			name:    "creates role with comment",
+			wanted:  map[string]Role{"alice": {Name: "alice", Comment: "From LDAP"}},
+			present: map[string]Role{},
+			want: []string{
+				`CREATE ROLE "alice" WITH LOGIN;`,
+				`COMMENT ON ROLE "alice" IS 'From LDAP';`,
+			},
+		},
+		{
+			name:    "ensures login on existing role",
+			wanted:  map[string]Role{"alice": {Name: "alice"}},
+			present: map[string]Role{"alice": {Name: "alice"}},
+			want:    []string{`ALTER ROLE "alice" WITH LOGIN;`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := diffRoles(tc.wanted, tc.present)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("diffRoles() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOrphanRoles(t *testing.T) {
+	cases := []struct {
+		name    string
+		wanted  map[string]Role
+		present map[string]Role
+		managed map[string]bool
+		want    []string
+	}{
+		{
+			name:    "drops managed orphan role",
+			wanted:  map[string]Role{},
+			present: map[string]Role{"orphan": {Name: "orphan"}},
+			managed: map[string]bool{"orphan": true},
+			want:    []string{`DROP ROLE "orphan";`},
+		},
+		{
+			name:    "never drops a role outside the managed scope",
+			wanted:  map[string]Role{},
+			present: map[string]Role{"rds_superuser": {Name: "rds_superuser"}},
+			managed: map[string]bool{},
+			want:    nil,
+		},
+		{
+			name:    "leaves wanted roles alone",
+			wanted:  map[string]Role{"alice": {Name: "alice"}},
+			present: map[string]Role{"alice": {Name: "alice"}},
+			managed: map[string]bool{"alice": true},
+			want:    nil,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := orphanRoles(tc.wanted, tc.present, tc.managed)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("orphanRoles() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package inspect
+
+import "path/filepath"
+
+// Blacklist is a set of glob patterns (as matched by filepath.Match — `*` and
+// `?` wildcards) excluding matching role names from what ldap2pg considers
+// managed, applied after the managed-roles query has run.
+type Blacklist []string
+
+// Matches reports whether name matches any pattern in the blacklist. A
+// malformed pattern never matches rather than failing the whole sync.
+func (b Blacklist) Matches(name string) bool {
+	for _, pattern := range b {
+		ok, err := filepath.Match(pattern, name)
+		if err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package inspect
+
+import "testing"
+
+func TestBlacklistMatches(t *testing.T) {
+	cases := []struct {
+		name      string
+		blacklist Blacklist
+		role      string
+		want      bool
+	}{
+		{"empty blacklist", nil, "alice", false},
+		{"exact match", Blacklist{"rds_superuser"}, "rds_superuser", true},
+		{"glob match", Blacklist{"rds_*"}, "rds_replication", true},
+		{"no match", Blacklist{"rds_*"}, "alice", false},
+		{"first of several patterns", Blacklist{"pg_*", "rds_*"}, "pg_monitor", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.blacklist.Matches(tc.role)
+			if got != tc.want {
+				t.Errorf("Matches(%q) = %v, want %v", tc.role, got, tc.want)
+			}
+		})
+	}
+}
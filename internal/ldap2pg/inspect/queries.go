@@ -0,0 +1,96 @@
+// Package inspect owns the SQL ldap2pg uses to introspect a Postgres
+// cluster. Every query has a sensible default but can be overridden per
+// cluster, e.g. to filter out rds_* roles on AWS or restrict the schemas
+// ldap2pg is allowed to touch.
+package inspect
+
+// DefaultRolesQuery lists every role in the cluster along with its comment
+// and its direct memberships.
+const DefaultRolesQuery = `
+SELECT
+    r.rolname,
+    COALESCE(d.description, ''),
+    COALESCE(array_agg(g.rolname) FILTER (WHERE g.rolname IS NOT NULL), '{}')
+FROM pg_catalog.pg_roles AS r
+LEFT JOIN pg_catalog.pg_shdescription AS d
+    ON d.objoid = r.oid AND d.classoid = 'pg_catalog.pg_authid'::regclass
+LEFT JOIN pg_catalog.pg_auth_members AS m ON m.member = r.oid
+LEFT JOIN pg_catalog.pg_roles AS g ON g.oid = m.roleid
+GROUP BY r.rolname, d.description;
+`
+
+// DefaultManagedRolesQuery restricts which of those roles ldap2pg is
+// allowed to create, alter or drop. It excludes the roles Postgres itself
+// owns; clusters with their own unmanaged roles (e.g. RDS's rds_* roles)
+// override it to exclude those too.
+const DefaultManagedRolesQuery = `
+SELECT rolname FROM pg_catalog.pg_roles WHERE rolname !~ '^pg_';
+`
+
+// DefaultDatabasesQuery lists the databases ldap2pg may consider when
+// walking per-database objects such as schemas.
+//
+// Nothing calls this query yet: Syncer only reconciles roles, which are
+// cluster-wide, so there is no per-database walk to feed it to. It's kept
+// here, with its databases_query override, as a documented no-op so the
+// config knob the backlog asked for exists ahead of that walk landing,
+// instead of silently disappearing.
+const DefaultDatabasesQuery = `
+SELECT datname FROM pg_catalog.pg_database WHERE datallowconn ORDER BY 1;
+`
+
+// DefaultSchemasQuery lists the schemas ldap2pg may consider in the
+// database it is currently connected to.
+//
+// Like DefaultDatabasesQuery, this is a documented no-op until ldap2pg
+// grows schema-level sync_map items.
+const DefaultSchemasQuery = `
+SELECT nspname FROM pg_catalog.pg_namespace
+WHERE nspname NOT IN ('pg_catalog', 'information_schema') ORDER BY 1;
+`
+
+// Queries holds the, possibly user-overridden, SQL used to introspect a
+// cluster.
+type Queries struct {
+	Roles        string
+	ManagedRoles string
+	Databases    string
+	Schemas      string
+}
+
+// NewQueries returns the built-in defaults.
+func NewQueries() Queries {
+	return Queries{
+		Roles:        DefaultRolesQuery,
+		ManagedRoles: DefaultManagedRolesQuery,
+		Databases:    DefaultDatabasesQuery,
+		Schemas:      DefaultSchemasQuery,
+	}
+}
+
+// Overrides holds the user-supplied replacements for one or more queries,
+// as read from the postgres: block of the configuration file.
+type Overrides struct {
+	RolesQuery        string `yaml:"roles_query"`
+	ManagedRolesQuery string `yaml:"managed_roles_query"`
+	DatabasesQuery    string `yaml:"databases_query"`
+	SchemasQuery      string `yaml:"schemas_query"`
+}
+
+// Apply replaces every query that has a non-empty override, leaving the
+// rest at their default.
+func (q Queries) Apply(overrides Overrides) Queries {
+	if overrides.RolesQuery != "" {
+		q.Roles = overrides.RolesQuery
+	}
+	if overrides.ManagedRolesQuery != "" {
+		q.ManagedRoles = overrides.ManagedRolesQuery
+	}
+	if overrides.DatabasesQuery != "" {
+		q.Databases = overrides.DatabasesQuery
+	}
+	if overrides.SchemasQuery != "" {
+		q.Schemas = overrides.SchemasQuery
+	}
+	return q
+}
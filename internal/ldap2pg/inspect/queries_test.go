@@ -0,0 +1,30 @@
+package inspect
+
+import "testing"
+
+func TestQueriesApply(t *testing.T) {
+	defaults := NewQueries()
+
+	overridden := defaults.Apply(Overrides{
+		RolesQuery:     "SELECT rolname FROM my_roles;",
+		DatabasesQuery: "SELECT datname FROM my_databases;",
+		SchemasQuery:   "SELECT nspname FROM my_schemas;",
+	})
+	if overridden.Roles != "SELECT rolname FROM my_roles;" {
+		t.Errorf("Roles = %q, want override", overridden.Roles)
+	}
+	if overridden.Databases != "SELECT datname FROM my_databases;" {
+		t.Errorf("Databases = %q, want override", overridden.Databases)
+	}
+	if overridden.Schemas != "SELECT nspname FROM my_schemas;" {
+		t.Errorf("Schemas = %q, want override", overridden.Schemas)
+	}
+	if overridden.ManagedRoles != defaults.ManagedRoles {
+		t.Errorf("ManagedRoles changed without an override")
+	}
+
+	untouched := defaults.Apply(Overrides{})
+	if untouched != defaults {
+		t.Errorf("Apply(Overrides{}) = %+v, want unchanged defaults %+v", untouched, defaults)
+	}
+}
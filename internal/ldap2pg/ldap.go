@@ -0,0 +1,112 @@
+package ldap2pg
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// LDAPClient abstracts the subset of *ldap.Conn used by ldap2pg so that the
+// synchronization logic can be exercised against a fake in tests.
+type LDAPClient interface {
+	LDAPSearcher
+	WhoAmI(controls []ldap.Control) (*ldap.WhoAmIResult, error)
+	Close() error
+}
+
+// ldapConn is the LDAPClient backed by a real *ldap.Conn.
+type ldapConn struct {
+	conn          *ldap.Conn
+	pageSize      uint32
+	referralDepth int
+}
+
+// NewLDAPClient dials the directory described by config, negotiating
+// STARTTLS or ldaps:// TLS when asked to, then binds using config.SaslMech.
+func NewLDAPClient(config LdapConfig) (client LDAPClient, err error) {
+	Logger.Debugw("LDAP dial.", "uri", config.Uri)
+
+	var dialOpts []ldap.DialOpt
+	if strings.HasPrefix(config.Uri, "ldaps://") {
+		var tlsConfig *tls.Config
+		tlsConfig, err = buildTLSConfig(config)
+		if err != nil {
+			return
+		}
+		dialOpts = append(dialOpts, ldap.DialWithTLSConfig(tlsConfig))
+	}
+
+	conn, err := ldap.DialURL(config.Uri, dialOpts...)
+	if err != nil {
+		return
+	}
+
+	if config.StartTLS && strings.HasPrefix(config.Uri, "ldap://") {
+		var tlsConfig *tls.Config
+		tlsConfig, err = buildTLSConfig(config)
+		if err != nil {
+			conn.Close()
+			return
+		}
+
+		Logger.Debugw("LDAP STARTTLS.")
+		err = conn.StartTLS(tlsConfig)
+		if err != nil {
+			conn.Close()
+			return
+		}
+	}
+
+	err = bind(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	pageSize := config.PageSize
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+	referralDepth := config.ReferralDepth
+	if referralDepth == 0 {
+		referralDepth = defaultReferralDepth
+	}
+
+	client = &ldapConn{conn: conn, pageSize: pageSize, referralDepth: referralDepth}
+	return
+}
+
+// buildTLSConfig builds the tls.Config used for both STARTTLS and ldaps://
+// connections, honoring tls_skip_verify and a custom CA chain.
+func buildTLSConfig(config LdapConfig) (tlsConfig *tls.Config, err error) {
+	tlsConfig = &tls.Config{InsecureSkipVerify: config.TLSSkipVerify} //nolint:gosec
+	if config.CAChain == "" {
+		return
+	}
+
+	pem, err := os.ReadFile(config.CAChain)
+	if err != nil {
+		err = fmt.Errorf("failed to read cachain %s: %w", config.CAChain, err)
+		return
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		err = fmt.Errorf("no certificate found in cachain %s", config.CAChain)
+		return
+	}
+	tlsConfig.RootCAs = pool
+	return
+}
+
+func (c *ldapConn) WhoAmI(controls []ldap.Control) (*ldap.WhoAmIResult, error) {
+	return c.conn.WhoAmI(controls)
+}
+
+func (c *ldapConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,28 @@
+package ldap2pg
+
+import (
+	"go.uber.org/zap"
+)
+
+// Logger is the package-wide sugared logger. It is initialized by
+// SetupLogging and used throughout this package.
+var Logger *zap.SugaredLogger
+
+// LogLevel controls the verbosity of Logger and can be changed at runtime,
+// once the configuration has been loaded.
+var LogLevel = zap.NewAtomicLevel()
+
+// SetupLogging initializes Logger with a console encoder suitable for a
+// CLI tool. It must be called once, before the configuration is loaded,
+// so that early failures can still be logged.
+func SetupLogging() (err error) {
+	cfg := zap.NewDevelopmentConfig()
+	cfg.Level = LogLevel
+	cfg.DisableStacktrace = true
+	logger, err := cfg.Build()
+	if err != nil {
+		return
+	}
+	Logger = logger.Sugar()
+	return
+}
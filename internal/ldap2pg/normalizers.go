@@ -3,46 +3,152 @@ package ldap2pg
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
-type KeyConflict struct {
-	Key      string
-	Conflict string
+// ParseError reports an invalid configuration value together with the path
+// to it in the document (e.g. "sync_map[3].roles[0].names[2]") and its
+// source position, so users don't have to guess which part of a large
+// sync_map is wrong.
+type ParseError struct {
+	Message string
+	Path    []string
+	Line    int
+	Column  int
 }
 
-func (err *KeyConflict) Error() string {
-	return "YAML alias conflict"
+func (err *ParseError) Error() string {
+	loc := fmt.Sprintf("line %d col %d", err.Line, err.Column)
+	if len(err.Path) == 0 {
+		return fmt.Sprintf("%s at %s", err.Message, loc)
+	}
+	return fmt.Sprintf("%s: %s at %s", strings.Join(err.Path, "."), err.Message, loc)
 }
 
-type ParseError struct {
-	Message string
-	Value   interface{}
+func newParseError(path []string, node *yaml.Node, format string, args ...interface{}) *ParseError {
+	err := &ParseError{
+		Message: fmt.Sprintf(format, args...),
+		Path:    append([]string{}, path...),
+	}
+	if node != nil {
+		err.Line = node.Line
+		err.Column = node.Column
+	}
+	return err
 }
 
-func (err *ParseError) Error() string {
-	return err.Message
+// subPath appends a new, optionally indexed, segment to path without
+// mutating it.
+func subPath(path []string, field string, index int) []string {
+	if index >= 0 {
+		field = fmt.Sprintf("%s[%d]", field, index)
+	}
+	return append(append([]string{}, path...), field)
 }
 
-func NormalizeAlias(yaml *map[string]interface{}, key, alias string) (err error) {
-	value, hasAlias := (*yaml)[alias]
-	if !hasAlias {
-		return
+// appendIndex adds an index to the last segment of path, e.g. turns
+// {"sync_map[3]", "names"} into {"sync_map[3]", "names[2]"}.
+func appendIndex(path []string, index int) []string {
+	out := append([]string{}, path...)
+	if len(out) == 0 {
+		return []string{fmt.Sprintf("[%d]", index)}
+	}
+	out[len(out)-1] = fmt.Sprintf("%s[%d]", out[len(out)-1], index)
+	return out
+}
+
+func describeKind(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "mapping"
+	case yaml.SequenceNode:
+		return "sequence"
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!str":
+			return "string"
+		case "!!int":
+			return "integer"
+		case "!!float":
+			return "float"
+		case "!!bool":
+			return "boolean"
+		case "!!null":
+			return "null"
+		default:
+			return "scalar"
+		}
+	default:
+		return "node"
 	}
+}
 
-	_, hasKey := (*yaml)[key]
-	if hasKey {
-		err = &KeyConflict{
-			Key:      key,
-			Conflict: alias,
+// mappingGet returns the value node for key in a mapping node, or nil.
+func mappingGet(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
 		}
+	}
+	return nil
+}
+
+// mappingSet inserts or replaces key -> value in a mapping node.
+func mappingSet(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// mappingDelete removes key from a mapping node, if present.
+func mappingDelete(node *yaml.Node, key string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content = append(node.Content[:i], node.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// normalizeAliasNode renames alias to key in a mapping node, failing if
+// both are present.
+func normalizeAliasNode(node *yaml.Node, key, alias string, path []string) (err error) {
+	aliasValue := mappingGet(node, alias)
+	if aliasValue == nil {
+		return
+	}
+	if mappingGet(node, key) != nil {
+		err = newParseError(subPath(path, key, -1), aliasValue, "alias %q conflicts with %q", alias, key)
 		return
 	}
+	mappingDelete(node, alias)
+	mappingSet(node, key, aliasValue)
+	return
+}
 
-	delete(*yaml, alias)
-	(*yaml)[key] = value
+// checkUnknownKeys fails if node has a key outside allowed. It is only
+// called in strict mode, once every alias on this level has already been
+// renamed to its canonical key.
+func checkUnknownKeys(node *yaml.Node, allowed map[string]bool, path []string) (err error) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode := node.Content[i]
+		if !allowed[keyNode.Value] {
+			err = newParseError(subPath(path, keyNode.Value, -1), keyNode, "unknown key %q", keyNode.Value)
+			return
+		}
+	}
 	return
 }
 
+// NormalizeList wraps a bare value in a one-element list, like ldap2pg
+// accepts `roles: admin` as well as `roles: [admin, readers]`.
 func NormalizeList(yaml interface{}) (list []interface{}) {
 	list, ok := yaml.([]interface{})
 	if !ok {
@@ -51,6 +157,10 @@ func NormalizeList(yaml interface{}) (list []interface{}) {
 	return
 }
 
+// NormalizeStringList is NormalizeList with the added guarantee that every
+// element is a string. It operates on already-decoded values (e.g. an
+// ldapsearch.attributes list), unlike the position-aware *Node normalizers
+// used for the rest of the configuration.
 func NormalizeStringList(yaml interface{}) (list []string, err error) {
 	iList, ok := yaml.([]interface{})
 	if !ok {
@@ -66,76 +176,140 @@ func NormalizeStringList(yaml interface{}) (list []string, err error) {
 	return
 }
 
-func NormalizeRoleRule(yaml interface{}) (rule map[string]interface{}, err error) {
-	var names []string
-	switch yaml.(type) {
-	case string:
-		rule = make(map[string]interface{})
-		names = append(names, yaml.(string))
-		rule["names"] = names
-	case map[string]interface{}:
-		rule = yaml.(map[string]interface{})
-		err = NormalizeAlias(&rule, "names", "name")
-		if err != nil {
-			return
+var roleRuleKeys = map[string]bool{"names": true, "comments": true}
+
+// normalizeStringListNode is NormalizeStringList for a yaml.Node: it accepts
+// either a bare scalar or a sequence of scalars, and reports the offending
+// element's position when one isn't a string.
+func normalizeStringListNode(node *yaml.Node, path []string) (list []string, err error) {
+	items := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		items = node.Content
+	}
+
+	for i, item := range items {
+		itemPath := path
+		if node.Kind == yaml.SequenceNode {
+			itemPath = appendIndex(path, i)
 		}
-		names, ok := rule["names"]
-		if ok {
-			rule["names"], err = NormalizeStringList(names)
-			if err != nil {
-				return
-			}
-		} else {
-			err = errors.New("Missing name in role rule")
+		if item.Kind != yaml.ScalarNode || item.Tag != "!!str" {
+			err = newParseError(itemPath, item, "expected string, got %s", describeKind(item))
 			return
 		}
-		err = NormalizeAlias(&rule, "comments", "comment")
-		if err != nil {
-			return
+		list = append(list, item.Value)
+	}
+	return
+}
+
+// normalizeRoleRuleNode turns one roles[] entry into {names, comments},
+// accepting either a bare role name or a mapping with name(s)/comment(s).
+func normalizeRoleRuleNode(node *yaml.Node, path []string, strict bool) (rule map[string]interface{}, err error) {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		rule = map[string]interface{}{
+			"names":    []string{node.Value},
+			"comments": []string{},
 		}
-		comments, ok := rule["comments"]
-		if !ok {
-			comments = []interface{}{}
+		return
+	}
+
+	if node.Kind != yaml.MappingNode {
+		err = newParseError(path, node, "expected string or mapping, got %s", describeKind(node))
+		return
+	}
+
+	err = normalizeAliasNode(node, "names", "name", path)
+	if err != nil {
+		return
+	}
+	err = normalizeAliasNode(node, "comments", "comment", path)
+	if err != nil {
+		return
+	}
+	if strict {
+		if err = checkUnknownKeys(node, roleRuleKeys, path); err != nil {
+			return
 		}
-		rule["comments"], err = NormalizeStringList(comments)
+	}
+
+	namesNode := mappingGet(node, "names")
+	if namesNode == nil {
+		err = newParseError(path, node, "missing name in role rule")
+		return
+	}
+	names, err := normalizeStringListNode(namesNode, subPath(path, "names", -1))
+	if err != nil {
+		return
+	}
+
+	comments := []string{}
+	if commentsNode := mappingGet(node, "comments"); commentsNode != nil {
+		comments, err = normalizeStringListNode(commentsNode, subPath(path, "comments", -1))
 		if err != nil {
 			return
 		}
-	default:
-		err = &ParseError{
-			Message: "Invalid role rule YAML",
-			Value:   yaml,
-		}
 	}
+
+	rule = map[string]interface{}{"names": names, "comments": comments}
 	return
 }
 
-func NormalizeSyncItem(yaml interface{}) (item map[string]interface{}, err error) {
-	item, ok := yaml.(map[string]interface{})
-	if !ok {
-		err = errors.New("Invalid sync item format")
+var syncItemKeys = map[string]bool{"description": true, "roles": true, "ldapsearch": true}
+
+// ldapsearchKeys mirrors the fields buildSearchRequest reads off an
+// ldapsearch block.
+var ldapsearchKeys = map[string]bool{
+	"base": true, "scope": true, "filter": true,
+	"attributes": true, "size_limit": true, "time_limit": true,
+}
+
+// normalizeSyncItemNode normalizes one sync_map entry: its description, its
+// roles[] rules, and its ldapsearch block.
+func normalizeSyncItemNode(node *yaml.Node, path []string, strict bool) (item map[string]interface{}, err error) {
+	if node.Kind != yaml.MappingNode {
+		err = newParseError(path, node, "expected mapping, got %s", describeKind(node))
 		return
 	}
 
-	descYaml, ok := item["description"]
-	if ok {
-		_, ok := descYaml.(string)
-		if !ok {
-			err = errors.New("Sync map item description must be string")
-			return
-		}
+	err = normalizeAliasNode(node, "roles", "role", path)
+	if err != nil {
+		return
 	}
-	err = NormalizeAlias(&item, "roles", "role")
+	err = normalizeAliasNode(node, "ldapsearch", "ldap", path)
 	if err != nil {
 		return
 	}
-	rawList, exists := item["roles"]
-	if exists {
-		list := NormalizeList(rawList)
-		rules := []interface{}{}
-		for _, rawRule := range list {
+	if strict {
+		if err = checkUnknownKeys(node, syncItemKeys, path); err != nil {
+			return
+		}
+	}
+
+	item = map[string]interface{}{}
+
+	if descNode := mappingGet(node, "description"); descNode != nil {
+		if descNode.Kind != yaml.ScalarNode || descNode.Tag != "!!str" {
+			err = newParseError(subPath(path, "description", -1), descNode, "expected string, got %s", describeKind(descNode))
+			return
+		}
+		item["description"] = descNode.Value
+	}
+
+	if rolesNode := mappingGet(node, "roles"); rolesNode != nil {
+		ruleNodes := []*yaml.Node{rolesNode}
+		isSequence := rolesNode.Kind == yaml.SequenceNode
+		if isSequence {
+			ruleNodes = rolesNode.Content
+		}
+
+		rules := make([]interface{}, 0, len(ruleNodes))
+		for i, ruleNode := range ruleNodes {
+			rulePath := subPath(path, "roles", -1)
+			if isSequence {
+				rulePath = appendIndex(rulePath, i)
+			}
+
 			var rule map[string]interface{}
-			rule, err = NormalizeRoleRule(rawRule)
+			rule, err = normalizeRoleRuleNode(ruleNode, rulePath, strict)
 			if err != nil {
 				return
 			}
@@ -144,30 +318,36 @@ func NormalizeSyncItem(yaml interface{}) (item map[string]interface{}, err error
 		item["roles"] = rules
 	}
 
-	err = NormalizeAlias(&item, "ldapsearch", "ldap")
-	if err != nil {
-		return
-	}
-	iLdapSearch, exists := item["ldapsearch"]
-	if exists {
-		ldapSearch, ok := iLdapSearch.(map[string]interface{})
-		if !ok {
-			err = errors.New("Invalid ldapsearch format")
+	if lsNode := mappingGet(node, "ldapsearch"); lsNode != nil {
+		if lsNode.Kind != yaml.MappingNode {
+			err = newParseError(subPath(path, "ldapsearch", -1), lsNode, "expected mapping, got %s", describeKind(lsNode))
 			return
 		}
-		item["ldapsearch"] = ldapSearch
+		if strict {
+			if err = checkUnknownKeys(lsNode, ldapsearchKeys, subPath(path, "ldapsearch", -1)); err != nil {
+				return
+			}
+		}
+		var ldapsearch interface{}
+		err = lsNode.Decode(&ldapsearch)
+		if err != nil {
+			return
+		}
+		item["ldapsearch"] = ldapsearch
 	}
 	return
 }
 
-func NormalizeSyncMap(yaml interface{}) (syncMap []interface{}, err error) {
-	rawItems, ok := yaml.([]interface{})
-	if !ok {
-		err = errors.New("Bad sync_map format")
+// normalizeSyncMapNode normalizes every entry of the sync_map sequence.
+func normalizeSyncMapNode(node *yaml.Node, strict bool) (syncMap []interface{}, err error) {
+	if node.Kind != yaml.SequenceNode {
+		err = newParseError([]string{"sync_map"}, node, "expected sequence, got %s", describeKind(node))
+		return
 	}
-	for _, rawItem := range rawItems {
-		var item interface{}
-		item, err = NormalizeSyncItem(rawItem)
+
+	for i, itemNode := range node.Content {
+		var item map[string]interface{}
+		item, err = normalizeSyncItemNode(itemNode, subPath(nil, "sync_map", i), strict)
 		if err != nil {
 			return
 		}
@@ -176,19 +356,70 @@ func NormalizeSyncMap(yaml interface{}) (syncMap []interface{}, err error) {
 	return
 }
 
-func NormalizeConfigRoot(yaml interface{}) (config map[string]interface{}, err error) {
-	config, ok := yaml.(map[string]interface{})
-	if !ok {
-		err = errors.New("Bad configuration format")
+var configRootKeys = map[string]bool{"sync_map": true, "ldap": true, "postgres": true}
+
+// ldapConfigKeys and postgresConfigKeys mirror LdapConfig's and
+// PostgresConfig's yaml tags (config.go), so a typo under ldap:/postgres:
+// is rejected the same way an unknown sync_map key is.
+var ldapConfigKeys = map[string]bool{
+	"uri": true, "binddn": true, "password": true,
+	"sasl_mech": true, "keytab": true,
+	"starttls": true, "tls_skip_verify": true, "cachain": true,
+	"page_size": true, "referral_hop_limit": true,
+}
+
+var postgresConfigKeys = map[string]bool{
+	"dsn": true, "session_role": true, "blacklist": true,
+	"roles_query": true, "managed_roles_query": true,
+	"databases_query": true, "schemas_query": true,
+}
+
+// NormalizeConfigRoot validates and normalizes the whole configuration
+// document. root is the *yaml.Node produced by unmarshaling the YAML file
+// into a yaml.Node, which carries line/column information down to every
+// scalar. In strict mode, an unknown key anywhere in the document is an
+// error instead of being silently ignored.
+func NormalizeConfigRoot(root *yaml.Node, strict bool) (config map[string]interface{}, err error) {
+	node := root
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			err = newParseError(nil, node, "empty document")
+			return
+		}
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		err = newParseError(nil, node, "expected mapping, got %s", describeKind(node))
 		return
 	}
+	if strict {
+		if err = checkUnknownKeys(node, configRootKeys, nil); err != nil {
+			return
+		}
+		if ldapNode := mappingGet(node, "ldap"); ldapNode != nil && ldapNode.Kind == yaml.MappingNode {
+			if err = checkUnknownKeys(ldapNode, ldapConfigKeys, []string{"ldap"}); err != nil {
+				return
+			}
+		}
+		if pgNode := mappingGet(node, "postgres"); pgNode != nil && pgNode.Kind == yaml.MappingNode {
+			if err = checkUnknownKeys(pgNode, postgresConfigKeys, []string{"postgres"}); err != nil {
+				return
+			}
+		}
+	}
 
-	rawSyncMap, ok := config["sync_map"]
-	if !ok {
-		err = errors.New("Missing sync_map")
+	err = node.Decode(&config)
+	if err != nil {
 		return
 	}
-	syncMap, err := NormalizeSyncMap(rawSyncMap)
+
+	syncMapNode := mappingGet(node, "sync_map")
+	if syncMapNode == nil {
+		err = newParseError(nil, node, "missing sync_map")
+		return
+	}
+
+	syncMap, err := normalizeSyncMapNode(syncMapNode, strict)
 	if err != nil {
 		return
 	}
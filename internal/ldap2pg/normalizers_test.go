@@ -0,0 +1,175 @@
+package ldap2pg
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parseNode(t *testing.T, doc string) *yaml.Node {
+	t.Helper()
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(doc), &node); err != nil {
+		t.Fatalf("yaml.Unmarshal(%q) error = %v", doc, err)
+	}
+	return &node
+}
+
+func TestNormalizeConfigRoot(t *testing.T) {
+	cases := []struct {
+		name    string
+		doc     string
+		strict  bool
+		wantErr string
+	}{
+		{
+			name: "minimal sync_map",
+			doc: `
+sync_map:
+- roles: admin
+`,
+		},
+		{
+			name: "role alias",
+			doc: `
+sync_map:
+- role: admin
+`,
+		},
+		{
+			name: "name and comment aliases",
+			doc: `
+sync_map:
+- roles:
+  - name: admin
+    comment: Superuser
+`,
+		},
+		{
+			name:    "missing sync_map",
+			doc:     `ldap: {}`,
+			wantErr: "missing sync_map",
+		},
+		{
+			name: "wrong type deep in the tree reports path and position",
+			doc: `
+sync_map:
+- roles:
+  - names:
+    - admin
+    - readers
+    - {}
+`,
+			wantErr: "sync_map[0].roles[0].names[2]: expected string, got mapping at line 7 col 7",
+		},
+		{
+			name:    "strict mode rejects a typo'd key",
+			doc:     "sync_map:\n- roless: admin\n",
+			strict:  true,
+			wantErr: "sync_map[0].roless: unknown key",
+		},
+		{
+			name: "non-strict mode ignores a typo'd key",
+			doc:  "sync_map:\n- roless: admin\n",
+		},
+		{
+			name:    "strict mode rejects a typo'd ldapsearch key",
+			doc:     "sync_map:\n- ldapsearch:\n    bas: dc=acme,dc=fr\n",
+			strict:  true,
+			wantErr: "sync_map[0].ldapsearch.bas: unknown key",
+		},
+		{
+			name: "non-strict mode ignores a typo'd ldapsearch key",
+			doc:  "sync_map:\n- ldapsearch:\n    bas: dc=acme,dc=fr\n",
+		},
+		{
+			name:    "strict mode rejects a typo'd ldap key",
+			doc:     "ldap:\n  biinddn: cn=admin\nsync_map: []\n",
+			strict:  true,
+			wantErr: "ldap.biinddn: unknown key",
+		},
+		{
+			name: "non-strict mode ignores a typo'd ldap key",
+			doc:  "ldap:\n  biinddn: cn=admin\nsync_map: []\n",
+		},
+		{
+			name:    "strict mode rejects a typo'd postgres key",
+			doc:     "postgres:\n  dns: postgres:///\nsync_map: []\n",
+			strict:  true,
+			wantErr: "postgres.dns: unknown key",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			node := parseNode(t, tc.doc)
+			_, err := NormalizeConfigRoot(node, tc.strict)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NormalizeConfigRoot() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("NormalizeConfigRoot() error = nil, want %q", tc.wantErr)
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("NormalizeConfigRoot() error = %q, want to contain %q", err.Error(), tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseErrorCarriesPosition(t *testing.T) {
+	node := parseNode(t, "sync_map:\n- roles: {}\n")
+	_, err := NormalizeConfigRoot(node, false)
+	if err == nil {
+		t.Fatal("NormalizeConfigRoot() error = nil, want error")
+	}
+	parseErr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("error type = %T, want *ParseError", err)
+	}
+	if parseErr.Line == 0 || parseErr.Column == 0 {
+		t.Errorf("ParseError has no position: %+v", parseErr)
+	}
+}
+
+// corpus seeds the fuzzer with every document exercised by TestNormalizeConfigRoot,
+// so it starts mutating from documents we know are interesting.
+var corpus = []string{
+	"sync_map:\n- roles: admin\n",
+	"sync_map:\n- role: admin\n",
+	"sync_map:\n- roles:\n  - name: admin\n    comment: Superuser\n",
+	"ldap: {}\n",
+	"sync_map:\n- roles:\n  - names:\n    - admin\n    - readers\n    - {}\n",
+	"sync_map:\n- roless: admin\n",
+	"sync_map:\n- ldapsearch:\n    bas: dc=acme,dc=fr\n",
+	"ldap:\n  biinddn: cn=admin\nsync_map: []\n",
+	"postgres:\n  dns: postgres:///\nsync_map: []\n",
+}
+
+func FuzzNormalizeConfigRoot(f *testing.F) {
+	for _, doc := range corpus {
+		f.Add(doc)
+	}
+
+	f.Fuzz(func(t *testing.T, doc string) {
+		var node yaml.Node
+		if err := yaml.Unmarshal([]byte(doc), &node); err != nil {
+			return
+		}
+		if len(node.Content) == 0 {
+			return
+		}
+
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("NormalizeConfigRoot panicked on %q: %v", doc, r)
+			}
+		}()
+		_, _ = NormalizeConfigRoot(&node, false)
+		_, _ = NormalizeConfigRoot(&node, true)
+	})
+}
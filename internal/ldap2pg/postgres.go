@@ -0,0 +1,131 @@
+package ldap2pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dalibo/ldap2pg/internal/ldap2pg/inspect"
+	"github.com/jackc/pgx/v4"
+)
+
+// PostgresInspector abstracts the subset of *pgx.Conn used by ldap2pg so
+// that the synchronization logic can be exercised against a fake in tests.
+type PostgresInspector interface {
+	CurrentUser(ctx context.Context) (string, error)
+	Roles(ctx context.Context) (map[string]Role, error)
+	ManagedRoles(ctx context.Context) (map[string]bool, error)
+	Apply(ctx context.Context, statements []string) error
+	Close(ctx context.Context) error
+}
+
+// pgxInspector is the PostgresInspector backed by a real *pgx.Conn.
+type pgxInspector struct {
+	conn      *pgx.Conn
+	queries   inspect.Queries
+	blacklist inspect.Blacklist
+}
+
+// NewPostgresInspector connects to the cluster described by config,
+// switches to config.SessionRole if one is set, and prepares the
+// (possibly overridden) introspection queries from config.
+func NewPostgresInspector(config PostgresConfig) (inspector PostgresInspector, err error) {
+	Logger.Debugw("PostgreSQL connection.", "dsn", config.Dsn)
+	conn, err := pgx.Connect(context.Background(), config.Dsn)
+	if err != nil {
+		return
+	}
+
+	if config.SessionRole != "" {
+		Logger.Debugw("PostgreSQL session role.", "role", config.SessionRole)
+		_, err = conn.Exec(context.Background(), fmt.Sprintf("SET ROLE %s;", quoteIdent(config.SessionRole)))
+		if err != nil {
+			conn.Close(context.Background()) //nolint:errcheck
+			return
+		}
+	}
+
+	inspector = &pgxInspector{
+		conn:      conn,
+		queries:   inspect.NewQueries().Apply(config.Overrides),
+		blacklist: config.Blacklist,
+	}
+	return
+}
+
+func (i *pgxInspector) CurrentUser(ctx context.Context) (me string, err error) {
+	err = i.conn.QueryRow(ctx, "SELECT CURRENT_USER;").Scan(&me)
+	return
+}
+
+// Roles returns every role currently in the cluster, keyed by name, minus
+// anything matching config.Blacklist.
+func (i *pgxInspector) Roles(ctx context.Context) (roles map[string]Role, err error) {
+	rows, err := i.conn.Query(ctx, i.queries.Roles)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	roles = make(map[string]Role)
+	for rows.Next() {
+		var role Role
+		err = rows.Scan(&role.Name, &role.Comment, &role.Members)
+		if err != nil {
+			return
+		}
+		if i.blacklist.Matches(role.Name) {
+			continue
+		}
+		roles[role.Name] = role
+	}
+	err = rows.Err()
+	return
+}
+
+// ManagedRoles returns the set of role names ldap2pg is allowed to create,
+// alter or drop, minus anything matching config.Blacklist.
+func (i *pgxInspector) ManagedRoles(ctx context.Context) (managed map[string]bool, err error) {
+	rows, err := i.conn.Query(ctx, i.queries.ManagedRoles)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	managed = make(map[string]bool)
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return
+		}
+		if i.blacklist.Matches(name) {
+			continue
+		}
+		managed[name] = true
+	}
+	err = rows.Err()
+	return
+}
+
+// Apply runs statements in a single transaction. It is the only place real
+// DDL happens, so that a failure midway through a sync item rolls back
+// cleanly instead of leaving the cluster half-migrated.
+func (i *pgxInspector) Apply(ctx context.Context, statements []string) (err error) {
+	tx, err := i.conn.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx) //nolint:errcheck
+
+	for _, statement := range statements {
+		_, err = tx.Exec(ctx, statement)
+		if err != nil {
+			return
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (i *pgxInspector) Close(ctx context.Context) error {
+	return i.conn.Close(ctx)
+}
@@ -0,0 +1,80 @@
+package ldap2pg
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// Role is a Postgres role, either the one currently in the cluster or the
+// one wanted from the directory.
+type Role struct {
+	Name    string
+	Comment string
+	Members []string
+}
+
+// expandRoleRule renders a normalized role rule (a roles[] entry) against a
+// single LDAP entry, producing one wanted Role per configured name. Names
+// and comments are Go text/template strings evaluated against the entry's
+// attributes, so `{{.cn}}` and `{{.mail}}` resolve to the entry's values.
+func expandRoleRule(rule map[string]interface{}, entry *ldap.Entry) (roles []Role, err error) {
+	names, ok := rule["names"].([]string)
+	if !ok {
+		err = fmt.Errorf("role rule has no names")
+		return
+	}
+	comments, _ := rule["comments"].([]string)
+	attrs := entryAttributes(entry)
+
+	for i, nameTpl := range names {
+		name, err0 := renderRoleTemplate(nameTpl, attrs)
+		if err0 != nil {
+			err = fmt.Errorf("bad role name template %q: %w", nameTpl, err0)
+			return
+		}
+
+		comment := ""
+		if i < len(comments) {
+			comment, err = renderRoleTemplate(comments[i], attrs)
+			if err != nil {
+				err = fmt.Errorf("bad role comment template %q: %w", comments[i], err)
+				return
+			}
+		}
+
+		roles = append(roles, Role{Name: name, Comment: comment})
+	}
+	return
+}
+
+func renderRoleTemplate(text string, attrs map[string]interface{}) (out string, err error) {
+	tpl, err := template.New("role").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	err = tpl.Execute(&buf, attrs)
+	if err != nil {
+		return
+	}
+	out = buf.String()
+	return
+}
+
+// entryAttributes flattens an *ldap.Entry into the map given to role
+// templates: single-valued attributes render as plain strings, multi-valued
+// ones as a slice so `{{range .member}}` still works.
+func entryAttributes(entry *ldap.Entry) map[string]interface{} {
+	attrs := make(map[string]interface{})
+	for _, attr := range entry.Attributes {
+		if len(attr.Values) == 1 {
+			attrs[attr.Name] = attr.Values[0]
+		} else {
+			attrs[attr.Name] = attr.Values
+		}
+	}
+	return attrs
+}
@@ -0,0 +1,66 @@
+package ldap2pg
+
+import (
+	"reflect"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestExpandRoleRule(t *testing.T) {
+	entry := ldap.NewEntry("uid=bob,ou=people,dc=acme,dc=fr", map[string][]string{
+		"cn":   {"bob"},
+		"mail": {"bob@acme.fr"},
+	})
+
+	cases := []struct {
+		name    string
+		rule    map[string]interface{}
+		want    []Role
+		wantErr bool
+	}{
+		{
+			name: "static name",
+			rule: map[string]interface{}{"names": []string{"readers"}, "comments": []string{}},
+			want: []Role{{Name: "readers"}},
+		},
+		{
+			name: "templated name and comment",
+			rule: map[string]interface{}{
+				"names":    []string{"{{.cn}}"},
+				"comments": []string{"Managed by ldap2pg for {{.mail}}"},
+			},
+			want: []Role{{Name: "bob", Comment: "Managed by ldap2pg for bob@acme.fr"}},
+		},
+		{
+			name:    "missing names",
+			rule:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			rule:    map[string]interface{}{"names": []string{"{{.cn"}, "comments": []string{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := expandRoleRule(tc.rule, entry)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("expandRoleRule() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expandRoleRule() = %v, want %v", got, tc.want)
+			}
+			for i := range tc.want {
+				if !reflect.DeepEqual(got[i], tc.want[i]) {
+					t.Errorf("role[%d] = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
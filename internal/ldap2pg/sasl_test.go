@@ -0,0 +1,81 @@
+package ldap2pg
+
+import "testing"
+
+func TestHostFromUri(t *testing.T) {
+	cases := []struct {
+		uri  string
+		want string
+	}{
+		{"ldap://ldap.acme.fr", "ldap.acme.fr"},
+		{"ldaps://ldap.acme.fr:636", "ldap.acme.fr"},
+		{"ldap://ldap.acme.fr:389/dc=acme,dc=fr", "ldap.acme.fr"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.uri, func(t *testing.T) {
+			got := hostFromUri(tc.uri)
+			if got != tc.want {
+				t.Errorf("hostFromUri(%q) = %q, want %q", tc.uri, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBindRejectsUnknownMech(t *testing.T) {
+	err := bind(nil, LdapConfig{SaslMech: "NTLM"})
+	if err == nil {
+		t.Fatal("bind() error = nil, want error for unknown sasl_mech")
+	}
+}
+
+// TestGssapiBindFailsWithoutKerberosEnvironment exercises gssapiBind's error
+// path in a test environment with no Kerberos configuration at all (no
+// /etc/krb5.conf, no keytab, no KRB5CCNAME): it must surface a clear error
+// rather than panicking or silently no-op'ing.
+func TestGssapiBindFailsWithoutKerberosEnvironment(t *testing.T) {
+	t.Setenv("KRB5CCNAME", "")
+	err := gssapiBind(nil, LdapConfig{SaslMech: "GSSAPI", Uri: "ldap://ldap.acme.fr"})
+	if err == nil {
+		t.Fatal("gssapiBind() error = nil, want error in an environment with no Kerberos configuration")
+	}
+}
+
+// TestKrb5GSSAPIClientContinuation makes sure InitSecContext(WithOptions)
+// doesn't touch the Kerberos client once the server has accepted our
+// AP-REQ: it must hand off to NegotiateSaslAuth instead of issuing a second
+// service ticket request.
+func TestKrb5GSSAPIClientContinuation(t *testing.T) {
+	client := &krb5GSSAPIClient{}
+
+	token, needContinue, err := client.InitSecContext("ldap/ldap.acme.fr", []byte{0x01})
+	if err != nil {
+		t.Fatalf("InitSecContext() error = %v", err)
+	}
+	if token != nil || needContinue {
+		t.Fatalf("InitSecContext() = (%v, %v), want (nil, false) once the server has replied", token, needContinue)
+	}
+
+	token, needContinue, err = client.InitSecContextWithOptions("ldap/ldap.acme.fr", []byte{0x01}, []int{1})
+	if err != nil {
+		t.Fatalf("InitSecContextWithOptions() error = %v", err)
+	}
+	if token != nil || needContinue {
+		t.Fatalf("InitSecContextWithOptions() = (%v, %v), want (nil, false) once the server has replied", token, needContinue)
+	}
+}
+
+func TestKrb5GSSAPIClientNegotiateSaslAuth(t *testing.T) {
+	client := &krb5GSSAPIClient{}
+	token, err := client.NegotiateSaslAuth([]byte{0x07, 0x00, 0x00, 0x00}, "")
+	if err != nil {
+		t.Fatalf("NegotiateSaslAuth() error = %v", err)
+	}
+	want := []byte{1, 0, 0, 0}
+	if len(token) != len(want) || token[0] != want[0] {
+		t.Errorf("NegotiateSaslAuth() = %v, want %v (no security layer)", token, want)
+	}
+	if err := client.DeleteSecContext(); err != nil {
+		t.Errorf("DeleteSecContext() error = %v", err)
+	}
+}
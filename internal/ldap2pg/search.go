@@ -0,0 +1,131 @@
+package ldap2pg
+
+import (
+	"fmt"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// defaultPageSize is the RFC 2696 page size used when the ldap
+// configuration doesn't set page_size, chosen so directories with tens of thousands of
+// members don't make us hold an unbounded result set in memory.
+const defaultPageSize = 1000
+
+// defaultReferralDepth bounds how many hops LDAPSearcher follows before it
+// gives up on a referral chain, as a safety net against referral loops.
+const defaultReferralDepth = 10
+
+var ldapScopes = map[string]int{
+	"base": ldap.ScopeBaseObject,
+	"one":  ldap.ScopeSingleLevel,
+	"sub":  ldap.ScopeWholeSubtree,
+}
+
+// LDAPSearcher runs a normalized ldapsearch (base, scope, filter,
+// attributes) against the directory, transparently paging through large
+// result sets and following any referrals it is handed.
+type LDAPSearcher interface {
+	SearchAll(ldapsearch map[string]interface{}) ([]*ldap.Entry, error)
+}
+
+// rawLDAPConn is the subset of *ldap.Conn the searcher drives directly. It
+// exists so tests can exercise paging and referral-following against a fake
+// without dialing a real directory.
+type rawLDAPConn interface {
+	SearchWithPaging(req *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error)
+	Close() error
+}
+
+// dialReferral opens a connection to a referral URI. It is a variable so
+// tests can stub out real dialing.
+var dialReferral = func(uri string) (rawLDAPConn, error) {
+	return ldap.DialURL(uri)
+}
+
+func (c *ldapConn) SearchAll(ldapsearch map[string]interface{}) (entries []*ldap.Entry, err error) {
+	req, err := buildSearchRequest(ldapsearch)
+	if err != nil {
+		return
+	}
+	return searchWithReferrals(c.conn, req, c.pageSize, c.referralDepth, 0)
+}
+
+// searchWithReferrals pages through req on conn and recurses into any
+// referral it receives, up to maxDepth hops.
+func searchWithReferrals(conn rawLDAPConn, req *ldap.SearchRequest, pageSize uint32, maxDepth, depth int) (entries []*ldap.Entry, err error) {
+	result, err := conn.SearchWithPaging(req, pageSize)
+	if err != nil {
+		return
+	}
+	entries = append(entries, result.Entries...)
+
+	for _, uri := range result.Referrals {
+		if depth >= maxDepth {
+			Logger.Debugw("LDAP referral depth exceeded, skipping.", "referral", uri, "depth", depth)
+			continue
+		}
+
+		var refConn rawLDAPConn
+		refConn, err = dialReferral(uri)
+		if err != nil {
+			return
+		}
+
+		var refEntries []*ldap.Entry
+		refEntries, err = searchWithReferrals(refConn, req, pageSize, maxDepth, depth+1)
+		refConn.Close() //nolint:errcheck
+		if err != nil {
+			return
+		}
+		entries = append(entries, refEntries...)
+	}
+	return
+}
+
+// buildSearchRequest turns a normalized ldapsearch map (base, scope, filter,
+// attributes) into an *ldap.SearchRequest.
+func buildSearchRequest(ldapsearch map[string]interface{}) (req *ldap.SearchRequest, err error) {
+	base, ok := ldapsearch["base"].(string)
+	if !ok || base == "" {
+		err = fmt.Errorf("ldapsearch is missing a base")
+		return
+	}
+
+	scope := ldap.ScopeWholeSubtree
+	if rawScope, ok := ldapsearch["scope"].(string); ok {
+		scope, ok = ldapScopes[rawScope]
+		if !ok {
+			err = fmt.Errorf("unknown ldapsearch scope %q", rawScope)
+			return
+		}
+	}
+
+	filter := "(objectClass=*)"
+	if rawFilter, ok := ldapsearch["filter"].(string); ok && rawFilter != "" {
+		filter = rawFilter
+	}
+
+	var attributes []string
+	if rawAttributes, ok := ldapsearch["attributes"]; ok {
+		attributes, err = NormalizeStringList(rawAttributes)
+		if err != nil {
+			return
+		}
+	}
+
+	sizeLimit := 0
+	if rawSizeLimit, ok := ldapsearch["size_limit"].(int); ok {
+		sizeLimit = rawSizeLimit
+	}
+
+	timeLimit := 0
+	if rawTimeLimit, ok := ldapsearch["time_limit"].(int); ok {
+		timeLimit = rawTimeLimit
+	}
+
+	req = ldap.NewSearchRequest(
+		base, scope, ldap.NeverDerefAliases, sizeLimit, timeLimit, false,
+		filter, attributes, nil,
+	)
+	return
+}
@@ -0,0 +1,160 @@
+package ldap2pg
+
+import (
+	"errors"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+type fakeRawConn struct {
+	result *ldap.SearchResult
+	err    error
+	closed bool
+}
+
+func (c *fakeRawConn) SearchWithPaging(req *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error) {
+	return c.result, c.err
+}
+
+func (c *fakeRawConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestSearchWithReferrals(t *testing.T) {
+	req, err := buildSearchRequest(map[string]interface{}{"base": "dc=acme,dc=fr"})
+	if err != nil {
+		t.Fatalf("buildSearchRequest() error = %v", err)
+	}
+
+	t.Run("plain result, no referral", func(t *testing.T) {
+		conn := &fakeRawConn{result: &ldap.SearchResult{
+			Entries: []*ldap.Entry{ldap.NewEntry("cn=alice,dc=acme,dc=fr", nil)},
+		}}
+
+		entries, err := searchWithReferrals(conn, req, defaultPageSize, defaultReferralDepth, 0)
+		if err != nil {
+			t.Fatalf("searchWithReferrals() error = %v", err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("entries = %v, want 1 entry", entries)
+		}
+	})
+
+	t.Run("follows a referral and merges entries", func(t *testing.T) {
+		referredConn := &fakeRawConn{result: &ldap.SearchResult{
+			Entries: []*ldap.Entry{ldap.NewEntry("cn=bob,dc=sub,dc=acme,dc=fr", nil)},
+		}}
+		defer func(orig func(string) (rawLDAPConn, error)) { dialReferral = orig }(dialReferral)
+		dialReferral = func(uri string) (rawLDAPConn, error) {
+			return referredConn, nil
+		}
+
+		conn := &fakeRawConn{result: &ldap.SearchResult{
+			Entries:   []*ldap.Entry{ldap.NewEntry("cn=alice,dc=acme,dc=fr", nil)},
+			Referrals: []string{"ldap://sub.acme.fr/dc=sub,dc=acme,dc=fr"},
+		}}
+
+		entries, err := searchWithReferrals(conn, req, defaultPageSize, defaultReferralDepth, 0)
+		if err != nil {
+			t.Fatalf("searchWithReferrals() error = %v", err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("entries = %v, want 2 entries", entries)
+		}
+		if !referredConn.closed {
+			t.Errorf("referral connection was not closed")
+		}
+	})
+
+	t.Run("stops at the configured depth", func(t *testing.T) {
+		calls := 0
+		defer func(orig func(string) (rawLDAPConn, error)) { dialReferral = orig }(dialReferral)
+		dialReferral = func(uri string) (rawLDAPConn, error) {
+			calls++
+			return nil, errors.New("should not be dialed")
+		}
+
+		conn := &fakeRawConn{result: &ldap.SearchResult{
+			Referrals: []string{"ldap://sub.acme.fr/dc=sub,dc=acme,dc=fr"},
+		}}
+
+		entries, err := searchWithReferrals(conn, req, defaultPageSize, 0, 0)
+		if err != nil {
+			t.Fatalf("searchWithReferrals() error = %v", err)
+		}
+		if len(entries) != 0 {
+			t.Fatalf("entries = %v, want none", entries)
+		}
+		if calls != 0 {
+			t.Errorf("dialReferral called %d times, want 0", calls)
+		}
+	})
+
+	t.Run("propagates search error", func(t *testing.T) {
+		conn := &fakeRawConn{err: errors.New("timeout")}
+		_, err := searchWithReferrals(conn, req, defaultPageSize, defaultReferralDepth, 0)
+		if err == nil {
+			t.Fatal("searchWithReferrals() error = nil, want error")
+		}
+	})
+}
+
+func TestBuildSearchRequest(t *testing.T) {
+	cases := []struct {
+		name       string
+		ldapsearch map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "missing base",
+			ldapsearch: map[string]interface{}{},
+			wantErr:    true,
+		},
+		{
+			name:       "defaults to whole subtree",
+			ldapsearch: map[string]interface{}{"base": "dc=acme,dc=fr"},
+		},
+		{
+			name:       "unknown scope",
+			ldapsearch: map[string]interface{}{"base": "dc=acme,dc=fr", "scope": "galaxy"},
+			wantErr:    true,
+		},
+		{
+			name: "full ldapsearch",
+			ldapsearch: map[string]interface{}{
+				"base":       "ou=people,dc=acme,dc=fr",
+				"scope":      "one",
+				"filter":     "(objectClass=posixAccount)",
+				"attributes": []interface{}{"cn", "mail"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := buildSearchRequest(tc.ldapsearch)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("buildSearchRequest() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuildSearchRequestCarriesLimits(t *testing.T) {
+	req, err := buildSearchRequest(map[string]interface{}{
+		"base":       "ou=people,dc=acme,dc=fr",
+		"size_limit": 500,
+		"time_limit": 30,
+	})
+	if err != nil {
+		t.Fatalf("buildSearchRequest() error = %v", err)
+	}
+	if req.SizeLimit != 500 {
+		t.Errorf("SizeLimit = %d, want 500", req.SizeLimit)
+	}
+	if req.TimeLimit != 30 {
+		t.Errorf("TimeLimit = %d, want 30", req.TimeLimit)
+	}
+}
@@ -0,0 +1,157 @@
+package ldap2pg
+
+import (
+	"context"
+	"fmt"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+// Syncer drives the synchronization of Postgres roles from the normalized
+// sync_map produced by LoadConfig.
+type Syncer struct {
+	LDAP     LDAPClient
+	Postgres PostgresInspector
+	SyncMap  []interface{}
+
+	DryRun        bool
+	DropUnmanaged bool
+}
+
+// NewSyncer builds a Syncer ready to Run over syncMap.
+func NewSyncer(ldapClient LDAPClient, pgInspector PostgresInspector, syncMap []interface{}) *Syncer {
+	return &Syncer{
+		LDAP:     ldapClient,
+		Postgres: pgInspector,
+		SyncMap:  syncMap,
+	}
+}
+
+// Run walks the sync_map one item at a time: for each item it resolves the
+// item's ldapsearch against the directory, expands its role rules into the
+// roles ldap2pg wants, diffs them against what is currently in Postgres, and
+// applies (or, in dry-run, just logs) the resulting SQL statements in their
+// own transaction — so a failure on one item never rolls back another
+// item's changes. Once every item has run, any managed roles left over in
+// Postgres that no item wanted are dropped in a final pass, if DropUnmanaged
+// is set.
+func (s *Syncer) Run(ctx context.Context) (err error) {
+	me, err := s.Postgres.CurrentUser(ctx)
+	if err != nil {
+		return
+	}
+	Logger.Infow("Connected to Postgres.", "user", me)
+
+	present, err := s.Postgres.Roles(ctx)
+	if err != nil {
+		return
+	}
+
+	managed, err := s.Postgres.ManagedRoles(ctx)
+	if err != nil {
+		return
+	}
+
+	wantedAll := make(map[string]Role)
+	for i, rawItem := range s.SyncMap {
+		item, ok := rawItem.(map[string]interface{})
+		if !ok {
+			err = fmt.Errorf("sync_map[%d]: not a sync item", i)
+			return
+		}
+
+		var itemWanted map[string]Role
+		itemWanted, err = s.resolveItemRoles(i, item)
+		if err != nil {
+			return
+		}
+		for name, role := range itemWanted {
+			wantedAll[name] = role
+		}
+
+		statements := diffRoles(itemWanted, present)
+		err = s.applyStatements(ctx, statements)
+		if err != nil {
+			return
+		}
+	}
+
+	if s.DropUnmanaged {
+		err = s.applyStatements(ctx, orphanRoles(wantedAll, present, managed))
+	}
+	return
+}
+
+// applyStatements logs statements (in dry-run) or applies them to Postgres
+// in their own transaction.
+func (s *Syncer) applyStatements(ctx context.Context, statements []string) (err error) {
+	if len(statements) == 0 {
+		return
+	}
+
+	if s.DryRun {
+		for _, statement := range statements {
+			Logger.Infow("Would run.", "sql", statement)
+		}
+		return
+	}
+
+	Logger.Infow("Applying changes.", "count", len(statements))
+	return s.Postgres.Apply(ctx, statements)
+}
+
+// resolveItemRoles runs a sync item's ldapsearch and expands its role rules
+// against every returned entry.
+func (s *Syncer) resolveItemRoles(index int, item map[string]interface{}) (wanted map[string]Role, err error) {
+	wanted = make(map[string]Role)
+
+	roles, ok := item["roles"].([]interface{})
+	if !ok || len(roles) == 0 {
+		return
+	}
+
+	entries, err := s.searchItem(item)
+	if err != nil {
+		err = fmt.Errorf("sync_map[%d]: %w", index, err)
+		return
+	}
+
+	for _, rawRule := range roles {
+		rule, ok := rawRule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, entry := range entries {
+			var expanded []Role
+			expanded, err = expandRoleRule(rule, entry)
+			if err != nil {
+				err = fmt.Errorf("sync_map[%d]: %w", index, err)
+				return
+			}
+			for _, role := range expanded {
+				merged := wanted[role.Name]
+				merged.Name = role.Name
+				if role.Comment != "" {
+					merged.Comment = role.Comment
+				}
+				wanted[role.Name] = merged
+			}
+		}
+	}
+	return
+}
+
+// searchItem runs a sync item's ldapsearch, or returns a single synthetic
+// entry with no attributes when the item has no ldapsearch at all — this
+// lets static role rules (plain names, no templating) work without a
+// directory round-trip.
+func (s *Syncer) searchItem(item map[string]interface{}) (entries []*ldap.Entry, err error) {
+	rawLdapsearch, ok := item["ldapsearch"].(map[string]interface{})
+	if !ok {
+		entries = append(entries, &ldap.Entry{})
+		return
+	}
+
+	entries, err = s.LDAP.SearchAll(rawLdapsearch)
+	return
+}
@@ -0,0 +1,269 @@
+package ldap2pg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	ldap "github.com/go-ldap/ldap/v3"
+)
+
+func TestMain(m *testing.M) {
+	if err := SetupLogging(); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+type fakeLDAPClient struct {
+	searchResult *ldap.SearchResult
+	searchErr    error
+}
+
+func (c *fakeLDAPClient) SearchAll(ldapsearch map[string]interface{}) ([]*ldap.Entry, error) {
+	if c.searchErr != nil {
+		return nil, c.searchErr
+	}
+	if c.searchResult == nil {
+		return nil, nil
+	}
+	return c.searchResult.Entries, nil
+}
+
+func (c *fakeLDAPClient) WhoAmI(controls []ldap.Control) (*ldap.WhoAmIResult, error) {
+	return &ldap.WhoAmIResult{AuthzID: "dn:cn=admin"}, nil
+}
+
+func (c *fakeLDAPClient) Close() error {
+	return nil
+}
+
+type fakePostgresInspector struct {
+	currentUser string
+	currentErr  error
+	roles       map[string]Role
+	rolesErr    error
+	managed     map[string]bool
+	managedErr  error
+	applied     []string
+	applyErr    error
+	failApplyAt int
+	applyCalls  int
+}
+
+func (i *fakePostgresInspector) CurrentUser(ctx context.Context) (string, error) {
+	return i.currentUser, i.currentErr
+}
+
+func (i *fakePostgresInspector) Roles(ctx context.Context) (map[string]Role, error) {
+	return i.roles, i.rolesErr
+}
+
+func (i *fakePostgresInspector) ManagedRoles(ctx context.Context) (map[string]bool, error) {
+	return i.managed, i.managedErr
+}
+
+func (i *fakePostgresInspector) Apply(ctx context.Context, statements []string) error {
+	i.applyCalls++
+	if i.failApplyAt != 0 && i.applyCalls == i.failApplyAt {
+		return i.applyErr
+	}
+	i.applied = append(i.applied, statements...)
+	return nil
+}
+
+func (i *fakePostgresInspector) Close(ctx context.Context) error {
+	return nil
+}
+
+func TestSyncerRun(t *testing.T) {
+	cases := []struct {
+		name    string
+		pg      *fakePostgresInspector
+		syncMap []interface{}
+		wantErr bool
+	}{
+		{
+			name:    "empty sync_map succeeds",
+			pg:      &fakePostgresInspector{currentUser: "postgres", roles: map[string]Role{}},
+			syncMap: nil,
+			wantErr: false,
+		},
+		{
+			name: "static role rule needs no ldapsearch",
+			pg:   &fakePostgresInspector{currentUser: "postgres", roles: map[string]Role{}},
+			syncMap: []interface{}{
+				map[string]interface{}{
+					"roles": []interface{}{
+						map[string]interface{}{"names": []string{"alice"}, "comments": []string{}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:    "propagates postgres connection error",
+			pg:      &fakePostgresInspector{currentErr: errors.New("connection reset")},
+			syncMap: nil,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			syncer := NewSyncer(&fakeLDAPClient{}, tc.pg, tc.syncMap)
+			syncer.DryRun = true
+			err := syncer.Run(context.Background())
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestSyncerRunApplies(t *testing.T) {
+	pg := &fakePostgresInspector{currentUser: "postgres", roles: map[string]Role{}}
+	syncMap := []interface{}{
+		map[string]interface{}{
+			"roles": []interface{}{
+				map[string]interface{}{"names": []string{"alice"}, "comments": []string{"Managed by ldap2pg"}},
+			},
+		},
+	}
+
+	syncer := NewSyncer(&fakeLDAPClient{}, pg, syncMap)
+	syncer.DryRun = false
+
+	err := syncer.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{
+		`CREATE ROLE "alice" WITH LOGIN;`,
+		`COMMENT ON ROLE "alice" IS 'Managed by ldap2pg';`,
+	}
+	if len(pg.applied) != len(want) {
+		t.Fatalf("applied = %v, want %v", pg.applied, want)
+	}
+	for i := range want {
+		if pg.applied[i] != want[i] {
+			t.Errorf("applied[%d] = %q, want %q", i, pg.applied[i], want[i])
+		}
+	}
+}
+
+func TestSyncerRunUsesLDAPEntries(t *testing.T) {
+	pg := &fakePostgresInspector{currentUser: "postgres", roles: map[string]Role{}}
+	ldapClient := &fakeLDAPClient{
+		searchResult: &ldap.SearchResult{
+			Entries: []*ldap.Entry{
+				ldap.NewEntry("uid=bob,ou=people,dc=acme,dc=fr", map[string][]string{
+					"cn": {"bob"},
+				}),
+			},
+		},
+	}
+	syncMap := []interface{}{
+		map[string]interface{}{
+			"ldapsearch": map[string]interface{}{"base": "ou=people,dc=acme,dc=fr"},
+			"roles": []interface{}{
+				map[string]interface{}{"names": []string{"{{.cn}}"}, "comments": []string{}},
+			},
+		},
+	}
+
+	syncer := NewSyncer(ldapClient, pg, syncMap)
+	syncer.DryRun = false
+
+	err := syncer.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := `CREATE ROLE "bob" WITH LOGIN;`
+	if len(pg.applied) != 1 || pg.applied[0] != want {
+		t.Fatalf("applied = %v, want [%q]", pg.applied, want)
+	}
+}
+
+// TestSyncerRunAppliesPerItem makes sure a failing sync item doesn't roll
+// back the statements an earlier item already applied in its own
+// transaction.
+func TestSyncerRunAppliesPerItem(t *testing.T) {
+	pg := &fakePostgresInspector{
+		currentUser: "postgres",
+		roles:       map[string]Role{},
+		failApplyAt: 2,
+		applyErr:    errors.New("boom"),
+	}
+	syncMap := []interface{}{
+		map[string]interface{}{
+			"roles": []interface{}{
+				map[string]interface{}{"names": []string{"alice"}, "comments": []string{}},
+			},
+		},
+		map[string]interface{}{
+			"roles": []interface{}{
+				map[string]interface{}{"names": []string{"bob"}, "comments": []string{}},
+			},
+		},
+	}
+
+	syncer := NewSyncer(&fakeLDAPClient{}, pg, syncMap)
+	syncer.DryRun = false
+
+	err := syncer.Run(context.Background())
+	if err == nil {
+		t.Fatal("Run() error = nil, want an error from the second item's Apply")
+	}
+
+	want := `CREATE ROLE "alice" WITH LOGIN;`
+	if len(pg.applied) != 1 || pg.applied[0] != want {
+		t.Fatalf("applied = %v, want [%q] (first item's own transaction must stick)", pg.applied, want)
+	}
+}
+
+// TestSyncerRunDropsOrphansAfterAllItems makes sure orphan roles are only
+// dropped once every sync item has contributed its wanted roles, in their
+// own final transaction.
+func TestSyncerRunDropsOrphansAfterAllItems(t *testing.T) {
+	pg := &fakePostgresInspector{
+		currentUser: "postgres",
+		roles:       map[string]Role{"orphan": {Name: "orphan"}},
+		managed:     map[string]bool{"orphan": true},
+	}
+	syncMap := []interface{}{
+		map[string]interface{}{
+			"roles": []interface{}{
+				map[string]interface{}{"names": []string{"alice"}, "comments": []string{}},
+			},
+		},
+	}
+
+	syncer := NewSyncer(&fakeLDAPClient{}, pg, syncMap)
+	syncer.DryRun = false
+	syncer.DropUnmanaged = true
+
+	err := syncer.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{
+		`CREATE ROLE "alice" WITH LOGIN;`,
+		`DROP ROLE "orphan";`,
+	}
+	if len(pg.applied) != len(want) {
+		t.Fatalf("applied = %v, want %v", pg.applied, want)
+	}
+	for i := range want {
+		if pg.applied[i] != want[i] {
+			t.Errorf("applied[%d] = %q, want %q", i, pg.applied[i], want[i])
+		}
+	}
+	if pg.applyCalls != 2 {
+		t.Errorf("applyCalls = %d, want 2 (one per sync item, one for orphans)", pg.applyCalls)
+	}
+}
@@ -0,0 +1,8 @@
+package ldap2pg
+
+// Version and ShortRevision are overridden at build time with
+// -ldflags "-X ...Version=... -X ...ShortRevision=...".
+var (
+	Version       string = "dev"
+	ShortRevision string = "HEAD"
+)